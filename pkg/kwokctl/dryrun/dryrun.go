@@ -0,0 +1,33 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dryrun renders the operations a `kwokctl create cluster
+// --dry-run` would have performed, without touching disk or the
+// network.
+package dryrun
+
+import (
+	"fmt"
+)
+
+// PrintMessage writes a formatted dry-run line to stdout, in the same
+// register as the shell command it stands in for. It backs the parts of
+// kwokctl that print a single command rather than recording an Op into a
+// Recorder (e.g. process supervision, which isn't part of a Recorder's
+// replayable artifact).
+func PrintMessage(format string, args ...any) {
+	fmt.Printf(format+"\n", args...)
+}
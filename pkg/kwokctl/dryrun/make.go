@@ -0,0 +1,217 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dryrun
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// MakeRenderer renders a recorded sequence of Ops as a Makefile whose
+// targets are named after the file each Op produces, so independent
+// branches of the cluster bring-up (e.g. downloading kube-apiserver
+// while etcd's PKI is generated) can run with `make -j`.
+type MakeRenderer struct{}
+
+// Render implements Renderer.
+func (MakeRenderer) Render(ops []Op) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(".PHONY: all\n")
+	// The `all` rule is written last, so name it as the goal a bare
+	// `make -j` builds instead of the first step's target.
+	b.WriteString(".DEFAULT_GOAL := all\n\n")
+	// make runs recipes with /bin/sh by default; recipes below use
+	// bash-only `<<<` here-strings, the same reason ShellRenderer
+	// shebangs `#!/bin/bash` instead of targeting POSIX sh.
+	b.WriteString("SHELL := /bin/bash\n\n")
+
+	mkdirTarget := map[string]string{}
+	writerTarget := map[string]string{}
+	var allTargets []string
+
+	for i, op := range ops {
+		path := opPath(op)
+		if path == "" {
+			return nil, fmt.Errorf("dryrun: make renderer does not know how to render %T", op)
+		}
+
+		target := fmt.Sprintf("step-%02d-%s", i, sanitizeTarget(path))
+		allTargets = append(allTargets, target)
+
+		var deps []string
+		if dirTarget, ok := mkdirTarget[filepath.Dir(path)]; ok {
+			deps = append(deps, dirTarget)
+		}
+		for _, readPath := range opReadPaths(op) {
+			if readerTarget, ok := writerTarget[readPath]; ok {
+				deps = append(deps, readerTarget)
+			}
+		}
+
+		if m, ok := op.(OpMkdir); ok {
+			mkdirTarget[m.Path] = target
+		}
+		if writesPath(op) {
+			writerTarget[path] = target
+		}
+
+		recipe, err := makeRecipe(op)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(&b, "%s:%s\n\t%s\n\n", target, depsSuffix(deps), recipe)
+	}
+
+	fmt.Fprintf(&b, "all: %s\n", strings.Join(allTargets, " "))
+	return b.Bytes(), nil
+}
+
+// opPath returns the path an Op primarily acts on, used both to name its
+// target and to find the Mkdir target it should depend on.
+func opPath(op Op) string {
+	switch o := op.(type) {
+	case OpDownload:
+		return o.Dest
+	case OpWriteFile:
+		return o.Path
+	case OpChmod:
+		return o.Path
+	case OpMkdir:
+		return o.Path
+	case OpRemove:
+		return o.Path
+	case OpCopy:
+		return o.Dest
+	case OpRename:
+		return o.Dest
+	case OpGeneratePKI:
+		return o.Path
+	case OpVerify:
+		return o.Path
+	default:
+		return ""
+	}
+}
+
+// writesPath reports whether op produces the file at opPath(op), so a
+// later op reading that same path (e.g. OpVerify checking a download)
+// can depend on the step that actually wrote it instead of running
+// concurrently with it under `make -j`.
+func writesPath(op Op) bool {
+	switch op.(type) {
+	case OpDownload, OpWriteFile, OpCopy, OpRename, OpGeneratePKI:
+		return true
+	default:
+		return false
+	}
+}
+
+// opReadPaths returns the paths op reads that must already have been
+// written by an earlier step, beyond the plain parent-directory Mkdir
+// dependency: OpVerify checks the file a download produced, OpCopy and
+// OpRename read their Src.
+func opReadPaths(op Op) []string {
+	switch o := op.(type) {
+	case OpVerify:
+		return []string{o.Path}
+	case OpCopy:
+		return []string{o.Src}
+	case OpRename:
+		return []string{o.Src}
+	default:
+		return nil
+	}
+}
+
+// makeRecipe renders the single shell line that produces an Op's output.
+func makeRecipe(op Op) (string, error) {
+	switch o := op.(type) {
+	case OpDownload:
+		src, dest := shQuote(o.Src), shQuote(o.Dest)
+		if o.Kind == DownloadOCI {
+			// crane takes a bare registry reference, without the oci:// scheme.
+			src = shQuote(strings.TrimPrefix(o.Src, "oci://"))
+			if o.Extract != "" {
+				return fmt.Sprintf("crane export %s - | tar -xf - %s -O >%s", src, shQuote(o.Extract), dest), nil
+			}
+			return fmt.Sprintf("crane export %s %s", src, dest), nil
+		}
+		if o.Extract != "" {
+			return fmt.Sprintf("curl -fsSL %s | tar -xf - %s -O >%s", src, shQuote(o.Extract), dest), nil
+		}
+		return fmt.Sprintf("curl -fsSL -o %s %s", dest, src), nil
+	case OpWriteFile:
+		recipe := fmt.Sprintf("base64 -d <<<%s >%s", base64.StdEncoding.EncodeToString(o.Content), shQuote(o.Path))
+		if o.Mode != 0 {
+			recipe += fmt.Sprintf(" && chmod 0%o %s", o.Mode, shQuote(o.Path))
+		}
+		return recipe, nil
+	case OpChmod:
+		return fmt.Sprintf("chmod 0%o %s", o.Mode, shQuote(o.Path)), nil
+	case OpMkdir:
+		return fmt.Sprintf("mkdir -p %s", shQuote(o.Path)), nil
+	case OpRemove:
+		if o.Recursive {
+			return fmt.Sprintf("rm -rf %s", shQuote(o.Path)), nil
+		}
+		return fmt.Sprintf("rm %s", shQuote(o.Path)), nil
+	case OpCopy:
+		return fmt.Sprintf("cp %s %s", shQuote(o.Src), shQuote(o.Dest)), nil
+	case OpRename:
+		return fmt.Sprintf("mv %s %s", shQuote(o.Src), shQuote(o.Dest)), nil
+	case OpGeneratePKI:
+		if len(o.Content) > 0 {
+			return fmt.Sprintf("base64 -d <<<%s | tar -C %s -xf -", base64.StdEncoding.EncodeToString(o.Content), shQuote(o.Path)), nil
+		}
+		return fmt.Sprintf("kwokctl debug generate-pki %s", shQuote(o.Path)), nil
+	case OpVerify:
+		var parts []string
+		if cmd, ok := o.checksumCommand(); ok {
+			parts = append(parts, cmd)
+		}
+		if o.SigURL != "" {
+			pubKeyPath := o.Path + ".pub"
+			parts = append(parts,
+				fmt.Sprintf("base64 -d <<<%s >%s", base64.StdEncoding.EncodeToString(o.PublicKey), shQuote(pubKeyPath)),
+				fmt.Sprintf("cosign verify-blob --key %s --signature %s %s", shQuote(pubKeyPath), shQuote(o.SigURL), shQuote(o.Path)),
+			)
+		}
+		return strings.Join(parts, " && "), nil
+	default:
+		return "", fmt.Errorf("dryrun: make renderer does not know how to render %T", op)
+	}
+}
+
+// depsSuffix renders a Makefile target's dependency list, or nothing if
+// there are none.
+func depsSuffix(deps []string) string {
+	if len(deps) == 0 {
+		return ""
+	}
+	return " " + strings.Join(deps, " ")
+}
+
+// sanitizeTarget turns a filesystem path into a safe Makefile target
+// fragment.
+func sanitizeTarget(path string) string {
+	r := strings.NewReplacer("/", "_", " ", "_", ":", "_")
+	return r.Replace(strings.TrimPrefix(path, "/"))
+}
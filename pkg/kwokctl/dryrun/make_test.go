@@ -0,0 +1,147 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dryrun
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMakeRendererSetsBashShell(t *testing.T) {
+	out, err := MakeRenderer{}.Render([]Op{OpMkdir{Path: "/work"}})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(string(out), "SHELL := /bin/bash") {
+		t.Errorf("Makefile does not set SHELL := /bin/bash, but recipes use bash-only <<< here-strings:\n%s", out)
+	}
+}
+
+func TestMakeRecipeOpDownload(t *testing.T) {
+	tests := []struct {
+		name string
+		op   OpDownload
+		want string
+	}{
+		{
+			name: "http",
+			op:   OpDownload{Src: "https://example.com/kwok", Dest: "/bin/kwok", Kind: DownloadHTTP},
+			want: "curl -fsSL -o '/bin/kwok' 'https://example.com/kwok'",
+		},
+		{
+			name: "http with extract",
+			op:   OpDownload{Src: "https://example.com/kwok.tar.gz", Dest: "/bin/kwok", Extract: "bin/kwok", Kind: DownloadHTTP},
+			want: "curl -fsSL 'https://example.com/kwok.tar.gz' | tar -xf - 'bin/kwok' -O >'/bin/kwok'",
+		},
+		{
+			name: "oci",
+			op:   OpDownload{Src: "oci://ghcr.io/kwok/kwok:v0.5.0", Dest: "/bin/kwok", Kind: DownloadOCI},
+			want: "crane export 'ghcr.io/kwok/kwok:v0.5.0' '/bin/kwok'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := makeRecipe(tt.op)
+			if err != nil {
+				t.Fatalf("makeRecipe: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("makeRecipe(%+v) = %q, want %q", tt.op, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMakeRecipeOpVerifyEmbedsPublicKey(t *testing.T) {
+	op := OpVerify{
+		Path:      "/bin/kube-apiserver",
+		SigURL:    "https://example.com/kube-apiserver.sig",
+		PublicKey: []byte("-----BEGIN PUBLIC KEY-----\nfake\n-----END PUBLIC KEY-----\n"),
+	}
+
+	got, err := makeRecipe(op)
+	if err != nil {
+		t.Fatalf("makeRecipe: %v", err)
+	}
+	if strings.Contains(got, "<pubkey>") {
+		t.Errorf("recipe still contains the unresolved <pubkey> placeholder: %q", got)
+	}
+	if !strings.Contains(got, "cosign verify-blob --key '/bin/kube-apiserver.pub' --signature '"+op.SigURL+"' '"+op.Path+"'") {
+		t.Errorf("recipe does not reference the materialized public key file: %q", got)
+	}
+}
+
+func TestMakeRecipeOpVerifyChecksum(t *testing.T) {
+	tests := []struct {
+		name    string
+		digest  string
+		wantCmd string
+	}{
+		{name: "sha256", digest: "sha256:abc", wantCmd: "echo 'abc  /bin/kwok' | sha256sum -c"},
+		{name: "sha512", digest: "sha512:def", wantCmd: "echo 'def  /bin/kwok' | sha512sum -c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := makeRecipe(OpVerify{Path: "/bin/kwok", Digest: tt.digest})
+			if err != nil {
+				t.Fatalf("makeRecipe: %v", err)
+			}
+			if got != tt.wantCmd {
+				t.Errorf("makeRecipe = %q, want %q", got, tt.wantCmd)
+			}
+		})
+	}
+}
+
+func TestMakeRendererVerifyDependsOnDownload(t *testing.T) {
+	ops := []Op{
+		OpDownload{Src: "https://example.com/kube-apiserver", Dest: "/bin/kube-apiserver", Kind: DownloadHTTP},
+		OpVerify{Path: "/bin/kube-apiserver", Digest: "sha256:abc"},
+	}
+
+	out, err := MakeRenderer{}.Render(ops)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+
+	script := string(out)
+	if !strings.Contains(script, "step-01-bin_kube-apiserver: step-00-bin_kube-apiserver") {
+		t.Errorf("expected the verify step to depend on the download step that wrote the same path, so `make -j` can't run them concurrently:\n%s", script)
+	}
+}
+
+func TestMakeRendererAllTargetsDepOnMkdir(t *testing.T) {
+	ops := []Op{
+		OpMkdir{Path: "/work"},
+		OpWriteFile{Path: "/work/config", Content: []byte("data")},
+	}
+
+	out, err := MakeRenderer{}.Render(ops)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+
+	script := string(out)
+	if !strings.Contains(script, "step-00-work") {
+		t.Errorf("expected the mkdir step's target in the recipe:\n%s", script)
+	}
+	if !strings.Contains(script, "step-01-work_config: step-00-work") {
+		t.Errorf("expected the write-file step to depend on the mkdir step:\n%s", script)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dryrun
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+// Op is one recorded dry-run operation. It is one of the Op* types
+// below; Renderers type-switch on it.
+type Op interface {
+	op()
+}
+
+// DownloadKind distinguishes how OpDownload.Src must be fetched, so a
+// Renderer can emit the command that actually understands the scheme.
+type DownloadKind int
+
+const (
+	// DownloadHTTP fetches Src with a plain HTTP(S) GET.
+	DownloadHTTP DownloadKind = iota
+	// DownloadOCI fetches Src by pulling an OCI artifact from a registry.
+	DownloadOCI
+)
+
+// OpDownload records fetching Src to Dest, optionally extracting Extract
+// from within the downloaded archive. Kind says whether Src is a plain
+// HTTP(S) URL or an oci:// reference.
+type OpDownload struct {
+	Src, Dest string
+	Extract   string
+	Kind      DownloadKind
+}
+
+// OpWriteFile records writing Content to Path with Mode.
+type OpWriteFile struct {
+	Path    string
+	Content []byte
+	Mode    fs.FileMode
+}
+
+// OpChmod records changing Path's mode to Mode.
+type OpChmod struct {
+	Path string
+	Mode fs.FileMode
+}
+
+// OpMkdir records creating Path and any missing parents.
+type OpMkdir struct {
+	Path string
+}
+
+// OpRemove records deleting Path, recursively if Recursive.
+type OpRemove struct {
+	Path      string
+	Recursive bool
+}
+
+// OpCopy records copying Src to Dest.
+type OpCopy struct {
+	Src, Dest string
+}
+
+// OpRename records renaming Src to Dest.
+type OpRename struct {
+	Src, Dest string
+}
+
+// OpGeneratePKI records generating a PKI rooted at Path for SANs. When
+// the recorder was asked to materialize PKI material, Content holds the
+// generated bytes (a tar of the PKI directory) so the rendered artifact
+// is self-contained; otherwise Content is nil and the artifact only
+// documents that this step must run.
+type OpGeneratePKI struct {
+	Path    string
+	SANs    []string
+	Content []byte
+}
+
+// OpVerify records the digest/signature check that would have run
+// against Path after a download.
+type OpVerify struct {
+	Path      string
+	Digest    string
+	SigURL    string
+	PublicKey []byte
+}
+
+// checksumCommand returns the `sha256sum`/`sha512sum` invocation that
+// checks Path against Digest, and false if Digest isn't set or doesn't
+// name a supported algorithm. Digest is `<algorithm>:<hex>`, but the
+// `*sum -c` tools expect a bare hex digest, so the algorithm is only used
+// to pick which tool to shell out to.
+func (o OpVerify) checksumCommand() (cmd string, ok bool) {
+	algo, hex, found := strings.Cut(o.Digest, ":")
+	if !found {
+		return "", false
+	}
+	var tool string
+	switch algo {
+	case "sha256":
+		tool = "sha256sum"
+	case "sha512":
+		tool = "sha512sum"
+	default:
+		return "", false
+	}
+	return fmt.Sprintf("echo %s | %s -c", shQuote(hex+"  "+o.Path), tool), true
+}
+
+func (OpDownload) op()    {}
+func (OpWriteFile) op()   {}
+func (OpChmod) op()       {}
+func (OpMkdir) op()       {}
+func (OpRemove) op()      {}
+func (OpCopy) op()        {}
+func (OpRename) op()      {}
+func (OpGeneratePKI) op() {}
+func (OpVerify) op()      {}
+
+// Recorder collects the Ops a dry run would have performed, in order,
+// so they can be rendered as a single reproducible artifact (a shell
+// script or a Makefile) instead of being printed as they happen.
+type Recorder struct {
+	// MaterializePKI, when set, tells GeneratePki-recording code to
+	// actually generate PKI material and embed it via OpGeneratePKI.Content
+	// rather than only documenting the step.
+	MaterializePKI bool
+
+	mu  sync.Mutex
+	ops []Op
+}
+
+// NewRecorder returns an empty Recorder. materializePKI sets MaterializePKI.
+func NewRecorder(materializePKI bool) *Recorder {
+	return &Recorder{MaterializePKI: materializePKI}
+}
+
+// Record appends op to the recorded sequence.
+func (r *Recorder) Record(op Op) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ops = append(r.ops, op)
+}
+
+// Ops returns a snapshot of the recorded operations, in recording order.
+func (r *Recorder) Ops() []Op {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Op(nil), r.ops...)
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dryrun
+
+import "fmt"
+
+// Renderer turns a recorded sequence of Ops into a self-contained,
+// reproducible artifact.
+type Renderer interface {
+	Render(ops []Op) ([]byte, error)
+}
+
+// RendererFor resolves the `kwokctl create cluster --dry-run` flag
+// value to a Renderer. An empty format keeps the script behavior kwokctl
+// has always had.
+func RendererFor(format string) (Renderer, error) {
+	switch format {
+	case "", "script":
+		return ShellRenderer{}, nil
+	case "make":
+		return MakeRenderer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown --dry-run format %q, want \"script\" or \"make\"", format)
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dryrun
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ShellRenderer renders a recorded sequence of Ops as a bash script:
+// running it reproduces the cluster bring-up on another host. It targets
+// bash specifically (not /bin/sh) because `set -o pipefail` isn't POSIX
+// and several system shells (dash on Debian/Ubuntu, busybox ash on
+// Alpine) reject it outright.
+type ShellRenderer struct{}
+
+// Render implements Renderer.
+func (ShellRenderer) Render(ops []Op) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("#!/bin/bash\nset -euo pipefail\n\n")
+
+	for _, op := range ops {
+		switch o := op.(type) {
+		case OpDownload:
+			src, dest := shQuote(o.Src), shQuote(o.Dest)
+			if o.Kind == DownloadOCI {
+				// crane takes a bare registry reference, without the oci:// scheme.
+				src = shQuote(strings.TrimPrefix(o.Src, "oci://"))
+				if o.Extract != "" {
+					fmt.Fprintf(&b, "# Download %s and extract %s to %s\ncrane export %s - | tar -xf - %s -O >%s\n\n", o.Src, o.Extract, o.Dest, src, shQuote(o.Extract), dest)
+				} else {
+					fmt.Fprintf(&b, "# Download %s to %s\ncrane export %s %s\n\n", o.Src, o.Dest, src, dest)
+				}
+			} else {
+				if o.Extract != "" {
+					fmt.Fprintf(&b, "# Download %s and extract %s to %s\ncurl -fsSL %s | tar -xf - %s -O >%s\n\n", o.Src, o.Extract, o.Dest, src, shQuote(o.Extract), dest)
+				} else {
+					fmt.Fprintf(&b, "# Download %s to %s\ncurl -fsSL -o %s %s\n\n", o.Src, o.Dest, dest, src)
+				}
+			}
+		case OpWriteFile:
+			writeHeredoc(&b, o.Path, o.Content)
+			if o.Mode != 0 {
+				fmt.Fprintf(&b, "chmod 0%o %s\n\n", o.Mode, shQuote(o.Path))
+			}
+		case OpChmod:
+			fmt.Fprintf(&b, "chmod 0%o %s\n\n", o.Mode, shQuote(o.Path))
+		case OpMkdir:
+			fmt.Fprintf(&b, "mkdir -p %s\n\n", shQuote(o.Path))
+		case OpRemove:
+			if o.Recursive {
+				fmt.Fprintf(&b, "rm -rf %s\n\n", shQuote(o.Path))
+			} else {
+				fmt.Fprintf(&b, "rm %s\n\n", shQuote(o.Path))
+			}
+		case OpCopy:
+			fmt.Fprintf(&b, "cp %s %s\n\n", shQuote(o.Src), shQuote(o.Dest))
+		case OpRename:
+			fmt.Fprintf(&b, "mv %s %s\n\n", shQuote(o.Src), shQuote(o.Dest))
+		case OpGeneratePKI:
+			fmt.Fprintf(&b, "# Generate PKI to %s (sans: %v)\n", o.Path, o.SANs)
+			if len(o.Content) > 0 {
+				body := base64.StdEncoding.EncodeToString(o.Content)
+				tag := heredocTagFor(body)
+				fmt.Fprintf(&b, "base64 -d <<'%s' | tar -C %s -xf -\n%s\n%s\n\n", tag, shQuote(o.Path), body, tag)
+			} else {
+				fmt.Fprintf(&b, "kwokctl debug generate-pki %s\n\n", shQuote(o.Path))
+			}
+		case OpVerify:
+			if cmd, ok := o.checksumCommand(); ok {
+				fmt.Fprintf(&b, "%s\n", cmd)
+			}
+			if o.SigURL != "" {
+				pubKeyPath := o.Path + ".pub"
+				body := base64.StdEncoding.EncodeToString(o.PublicKey)
+				tag := heredocTagFor(body)
+				fmt.Fprintf(&b, "base64 -d <<'%s' >%s\n%s\n%s\n", tag, shQuote(pubKeyPath), body, tag)
+				fmt.Fprintf(&b, "cosign verify-blob --key %s --signature %s %s\n", shQuote(pubKeyPath), shQuote(o.SigURL), shQuote(o.Path))
+			}
+			b.WriteString("\n")
+		default:
+			return nil, fmt.Errorf("dryrun: shell renderer does not know how to render %T", op)
+		}
+	}
+
+	return b.Bytes(), nil
+}
+
+// writeHeredoc appends a `cat <<TAG >path` heredoc, base64-encoding
+// content when it looks binary so the script stays valid UTF-8. TAG is
+// chosen so it can't collide with a line already in the embedded body.
+func writeHeredoc(b *bytes.Buffer, path string, content []byte) {
+	quotedPath := shQuote(path)
+	if looksBinary(content) {
+		body := base64.StdEncoding.EncodeToString(content)
+		tag := heredocTagFor(body)
+		fmt.Fprintf(b, "base64 -d <<'%s' >%s\n%s\n%s\n\n", tag, quotedPath, body, tag)
+		return
+	}
+	body := string(content)
+	tag := heredocTagFor(body)
+	fmt.Fprintf(b, "cat <<'%s' >%s\n%s\n%s\n\n", tag, quotedPath, body, tag)
+}
+
+// looksBinary reports whether content is not valid UTF-8 or contains a
+// NUL byte, the cheap heuristic used to decide whether a heredoc needs
+// base64 encoding.
+func looksBinary(content []byte) bool {
+	if !utf8.Valid(content) {
+		return true
+	}
+	for _, c := range content {
+		if c == 0 {
+			return true
+		}
+	}
+	return false
+}
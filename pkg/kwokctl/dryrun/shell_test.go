@@ -0,0 +1,167 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dryrun
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestShellRendererShebang(t *testing.T) {
+	out, err := ShellRenderer{}.Render([]Op{OpMkdir{Path: "/work"}})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	script := string(out)
+	if !strings.HasPrefix(script, "#!/bin/bash\n") {
+		t.Errorf("script should be shebanged for bash (it uses `set -o pipefail`, not POSIX sh), got:\n%s", script)
+	}
+}
+
+func TestShellRendererOpWriteFileQuotesPathAndEscapesHeredocCollision(t *testing.T) {
+	op := OpWriteFile{Path: "/work/my file", Content: []byte("line one\nEOF\nline three")}
+
+	out, err := ShellRenderer{}.Render([]Op{op})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	script := string(out)
+
+	if !strings.Contains(script, "cat <<'EOF_' >'/work/my file'") {
+		t.Errorf("script does not use a collision-safe heredoc tag and quote the path with a space:\n%s", script)
+	}
+	if !strings.Contains(script, "line one\nEOF\nline three\nEOF_\n") {
+		t.Errorf("script truncated the heredoc body at the embedded EOF line:\n%s", script)
+	}
+}
+
+func TestShellRendererQuotesPathsWithMetacharacters(t *testing.T) {
+	op := OpMkdir{Path: "/work/a b"}
+
+	out, err := ShellRenderer{}.Render([]Op{op})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	script := string(out)
+	if !strings.Contains(script, "mkdir -p '/work/a b'") {
+		t.Errorf("script does not quote a path containing a space:\n%s", script)
+	}
+}
+
+func TestShellRendererOpDownload(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      OpDownload
+		wantCmd string
+		noCmd   string
+	}{
+		{
+			name:    "http",
+			op:      OpDownload{Src: "https://example.com/kwok", Dest: "/bin/kwok", Kind: DownloadHTTP},
+			wantCmd: "curl -fsSL -o '/bin/kwok' 'https://example.com/kwok'",
+			noCmd:   "crane",
+		},
+		{
+			name:    "http with extract",
+			op:      OpDownload{Src: "https://example.com/kwok.tar.gz", Dest: "/bin/kwok", Extract: "bin/kwok", Kind: DownloadHTTP},
+			wantCmd: "curl -fsSL 'https://example.com/kwok.tar.gz' | tar -xf - 'bin/kwok' -O >'/bin/kwok'",
+			noCmd:   "crane",
+		},
+		{
+			name:    "oci",
+			op:      OpDownload{Src: "oci://ghcr.io/kwok/kwok:v0.5.0", Dest: "/bin/kwok", Kind: DownloadOCI},
+			wantCmd: "crane export 'ghcr.io/kwok/kwok:v0.5.0' '/bin/kwok'",
+			noCmd:   "curl",
+		},
+		{
+			name:    "oci with extract",
+			op:      OpDownload{Src: "oci://ghcr.io/kwok/kwok:v0.5.0", Dest: "/bin/kwok", Extract: "bin/kwok", Kind: DownloadOCI},
+			wantCmd: "crane export 'ghcr.io/kwok/kwok:v0.5.0' - | tar -xf - 'bin/kwok' -O >'/bin/kwok'",
+			noCmd:   "curl",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ShellRenderer{}.Render([]Op{tt.op})
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			script := string(out)
+			if !strings.Contains(script, tt.wantCmd) {
+				t.Errorf("script does not contain %q:\n%s", tt.wantCmd, script)
+			}
+			if strings.Contains(script, tt.noCmd) {
+				t.Errorf("script unexpectedly contains %q:\n%s", tt.noCmd, script)
+			}
+		})
+	}
+}
+
+func TestShellRendererOpVerifyEmbedsPublicKey(t *testing.T) {
+	op := OpVerify{
+		Path:      "/bin/kube-apiserver",
+		Digest:    "sha256:abc",
+		SigURL:    "https://example.com/kube-apiserver.sig",
+		PublicKey: []byte("-----BEGIN PUBLIC KEY-----\nfake\n-----END PUBLIC KEY-----\n"),
+	}
+
+	out, err := ShellRenderer{}.Render([]Op{op})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	script := string(out)
+
+	if strings.Contains(script, "<pubkey>") {
+		t.Errorf("script still contains the unresolved <pubkey> placeholder, which dash parses as input redirection:\n%s", script)
+	}
+	wantB64 := base64.StdEncoding.EncodeToString(op.PublicKey)
+	if !strings.Contains(script, wantB64) {
+		t.Errorf("script does not embed the public key material:\n%s", script)
+	}
+	if !strings.Contains(script, "cosign verify-blob --key '/bin/kube-apiserver.pub' --signature '"+op.SigURL+"' '"+op.Path+"'") {
+		t.Errorf("script does not reference the materialized public key file:\n%s", script)
+	}
+}
+
+func TestShellRendererOpVerifyChecksum(t *testing.T) {
+	tests := []struct {
+		name    string
+		digest  string
+		wantCmd string
+	}{
+		{name: "sha256", digest: "sha256:abc", wantCmd: "echo 'abc  /bin/kwok' | sha256sum -c"},
+		{name: "sha512", digest: "sha512:def", wantCmd: "echo 'def  /bin/kwok' | sha512sum -c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ShellRenderer{}.Render([]Op{OpVerify{Path: "/bin/kwok", Digest: tt.digest}})
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			script := string(out)
+			if !strings.Contains(script, tt.wantCmd) {
+				t.Errorf("script does not contain %q:\n%s", tt.wantCmd, script)
+			}
+			if strings.Contains(script, tt.digest) {
+				t.Errorf("script embeds the full %q digest instead of the bare hex sha256sum/sha512sum expects:\n%s", tt.digest, script)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dryrun
+
+import "strings"
+
+// shQuote single-quotes s for safe interpolation into a POSIX shell
+// command line, so a workdir path or URL containing a space or shell
+// metacharacter can't break the rendered script.
+func shQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// heredocTagFor returns a heredoc delimiter guaranteed not to appear as
+// a whole line in body, so recorded content containing a literal "EOF"
+// line can't truncate the heredoc early and corrupt the rest of the
+// script.
+func heredocTagFor(body string) string {
+	tag := "EOF"
+	for bodyHasLine(body, tag) {
+		tag += "_"
+	}
+	return tag
+}
+
+func bodyHasLine(body, line string) bool {
+	for _, l := range strings.Split(body, "\n") {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,363 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"sigs.k8s.io/kwok/pkg/utils/file"
+)
+
+// blobsDir is the content-addressable store under a cache directory:
+// downloaded artifacts and extracted archive entries are written once
+// to cacheDir/blobs/<algorithm>/<digest> and then hardlinked/reflinked
+// into every cluster that needs them, instead of being copied per
+// cluster.
+func blobsDir(cacheDir, algorithm string) string {
+	return filepath.Join(cacheDir, "blobs", algorithm)
+}
+
+// fetchToBlobStore fetches src into the blob store and returns the path
+// of the resulting blob. src may be a plain HTTP(S) URL, an `oci://`
+// reference, or either of those suffixed with `#path/inside/archive` to
+// extract a single file rather than storing the whole download.
+func fetchToBlobStore(ctx context.Context, cacheDir, src string, quiet bool) (string, error) {
+	if isOCI(src) {
+		return fetchOCIToBlobStore(ctx, cacheDir, parseOCIRef(src), quiet)
+	}
+	if s := strings.SplitN(src, "#", 2); len(s) == 2 {
+		return fetchArchiveEntryToBlobStore(ctx, cacheDir, s[0], s[1], quiet)
+	}
+	return fetchURLToBlobStore(ctx, cacheDir, src, quiet)
+}
+
+// fetchURLToBlobStore downloads src straight into the blob store, keyed
+// by the sha256 of its content.
+func fetchURLToBlobStore(ctx context.Context, cacheDir, src string, quiet bool) (string, error) {
+	dir := blobsDir(cacheDir, "sha256")
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(dir, "tmp-*")
+	if err != nil {
+		return "", err
+	}
+	tmpName := tmp.Name()
+	defer func() {
+		_ = os.Remove(tmpName)
+	}()
+
+	h := sha256.New()
+	err = file.Download(ctx, src, io.MultiWriter(tmp, h), quiet)
+	closeErr := tmp.Close()
+	if err != nil {
+		return "", err
+	}
+	if closeErr != nil {
+		return "", closeErr
+	}
+
+	return commitBlob(dir, tmpName, hex.EncodeToString(h.Sum(nil)))
+}
+
+// fetchArchiveEntryToBlobStore fetches archiveSrc into the blob store,
+// extracts entryPath from it, and stores the extracted file as its own
+// blob so every cluster using the same archive entry shares one copy.
+func fetchArchiveEntryToBlobStore(ctx context.Context, cacheDir, archiveSrc, entryPath string, quiet bool) (string, error) {
+	archiveBlob, err := fetchURLToBlobStore(ctx, cacheDir, archiveSrc, quiet)
+	if err != nil {
+		return "", err
+	}
+	return extractEntryToBlobStore(blobsDir(cacheDir, "sha256"), archiveBlob, entryPath, quiet)
+}
+
+// extractEntryToBlobStore extracts entryPath from the archive already
+// stored at archiveBlob and stores the extracted file as its own blob
+// under dir, so every caller extracting the same entry from the same
+// archive (an HTTP(S) tarball or an OCI layer) shares one copy.
+func extractEntryToBlobStore(dir, archiveBlob, entryPath string, quiet bool) (string, error) {
+	archive, err := os.Open(archiveBlob)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = archive.Close()
+	}()
+
+	tmp, err := os.CreateTemp(dir, "tmp-*")
+	if err != nil {
+		return "", err
+	}
+	tmpName := tmp.Name()
+	defer func() {
+		_ = os.Remove(tmpName)
+	}()
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	if err := file.ExtractFromTarReader(archive, entryPath, tmpName, 0640, quiet); err != nil {
+		return "", err
+	}
+
+	return hashFileAndCommit(dir, tmpName)
+}
+
+// writeToBlobStore copies r into a new blob under dir, keyed by its own
+// sha256 digest. It backs blob-store sources (like an OCI layer) that
+// aren't fetched through file.Download.
+func writeToBlobStore(dir string, r io.Reader) (string, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(dir, "tmp-*")
+	if err != nil {
+		return "", err
+	}
+	tmpName := tmp.Name()
+	defer func() {
+		_ = os.Remove(tmpName)
+	}()
+
+	_, err = io.Copy(tmp, r)
+	closeErr := tmp.Close()
+	if err != nil {
+		return "", err
+	}
+	if closeErr != nil {
+		return "", closeErr
+	}
+
+	return hashFileAndCommit(dir, tmpName)
+}
+
+// hashFileAndCommit hashes the file already written at tmpName and
+// commits it into dir under its digest.
+func hashFileAndCommit(dir, tmpName string) (string, error) {
+	h := sha256.New()
+	f, err := os.Open(tmpName)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(h, f)
+	closeErr := f.Close()
+	if err != nil {
+		return "", err
+	}
+	if closeErr != nil {
+		return "", closeErr
+	}
+
+	return commitBlob(dir, tmpName, hex.EncodeToString(h.Sum(nil)))
+}
+
+// commitBlob renames tmpName into dir under digest, reusing an existing
+// blob with the same digest if one is already there.
+func commitBlob(dir, tmpName, digest string) (string, error) {
+	blobPath := filepath.Join(dir, digest)
+
+	if _, err := os.Stat(blobPath); err == nil {
+		return blobPath, nil
+	}
+	if err := os.Rename(tmpName, blobPath); err != nil {
+		return "", err
+	}
+	return blobPath, nil
+}
+
+// materializeBlob places a copy of blobPath at dest with mode, trying
+// the cheapest option the filesystem supports first: a hardlink (same
+// device, instant, zero extra space), then a reflink (copy-on-write
+// clone, works across most modern filesystems for same-device copies
+// that shouldn't share inode semantics), and finally a real copy.
+func materializeBlob(blobPath, dest string, mode fs.FileMode) error {
+	firstLink, err := isUnlinkedBlob(blobPath)
+	if err != nil {
+		return err
+	}
+	if err := os.Link(blobPath, dest); err == nil {
+		// dest shares blobPath's inode, so chmod(dest) is chmod(blobPath):
+		// it would also re-permission every other cluster's hardlinked
+		// copy of this blob. Only set it the first time this blob is
+		// hardlinked, while the store's mode is still authoritative.
+		if firstLink {
+			return os.Chmod(blobPath, mode)
+		}
+		return nil
+	}
+
+	if err := reflink(blobPath, dest); err == nil {
+		if err := recordReflink(blobPath, dest); err != nil {
+			return err
+		}
+		return os.Chmod(dest, mode)
+	}
+
+	if err := file.Copy(blobPath, dest); err != nil {
+		return err
+	}
+	return os.Chmod(dest, mode)
+}
+
+// reflinksPath is the sidecar file next to blobPath that records every
+// destination it was reflinked to. A reflinked copy doesn't share
+// blobPath's inode, so it's otherwise invisible to GC's hardlink-count
+// check and would look unreferenced the moment it's created.
+func reflinksPath(blobPath string) string {
+	return blobPath + ".reflinks"
+}
+
+// recordReflink appends dest to blobPath's reflink sidecar.
+func recordReflink(blobPath, dest string) error {
+	f, err := os.OpenFile(reflinksPath(blobPath), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	_, err = fmt.Fprintln(f, dest)
+	return err
+}
+
+// hasLiveReflink reports whether any destination recorded in blobPath's
+// reflink sidecar still exists.
+func hasLiveReflink(blobPath string) bool {
+	data, err := os.ReadFile(reflinksPath(blobPath))
+	if err != nil {
+		return false
+	}
+	for _, dest := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if dest == "" {
+			continue
+		}
+		if _, err := os.Stat(dest); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// reflink clones src to dest with the FICLONE ioctl, succeeding only on
+// filesystems that support copy-on-write clones (e.g. btrfs, xfs, some
+// overlayfs configurations) with src and dest on the same device.
+func reflink(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0640)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+
+	if err := unix.IoctlFileClone(int(out.Fd()), int(in.Fd())); err != nil {
+		_ = os.Remove(dest)
+		return err
+	}
+	return nil
+}
+
+// GC removes blobs under cacheDir that are no longer linked from any
+// cluster's workdir, freeing disk space once components from old
+// kube-apiserver or etcd versions are no longer used by any cluster.
+// It backs the `kwokctl cache gc` command.
+//
+// A blob materialized via hardlink is caught by its Nlink; a blob
+// materialized via reflink doesn't share an inode with its copies, so
+// materializeBlob records every reflink destination in a sidecar file
+// next to the blob, and a blob is only considered unreferenced once none
+// of its recorded reflink destinations still exist either.
+func GC(cacheDir string, quiet bool) (freed int64, err error) {
+	dir := blobsDir(cacheDir, "sha256")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".reflinks") {
+			continue
+		}
+		blobPath := filepath.Join(dir, entry.Name())
+
+		info, err := os.Stat(blobPath)
+		if err != nil {
+			return freed, err
+		}
+		if !isUnreferenced(blobPath, info) {
+			continue
+		}
+
+		size := info.Size()
+		if err := os.Remove(blobPath); err != nil {
+			return freed, err
+		}
+		_ = os.Remove(reflinksPath(blobPath))
+		freed += size
+		if !quiet {
+			fmt.Printf("removed unreferenced blob %s (%d bytes)\n", blobPath, size)
+		}
+	}
+
+	return freed, nil
+}
+
+// isUnlinkedBlob reports whether blobPath is not yet hardlinked to any
+// materialized destination, i.e. it only has the store's own copy.
+func isUnlinkedBlob(blobPath string) (bool, error) {
+	info, err := os.Stat(blobPath)
+	if err != nil {
+		return false, err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return !ok || uint64(st.Nlink) <= 1, nil
+}
+
+// isUnreferenced reports whether blobPath (whose os.Stat result is info)
+// has no remaining hardlink other than the store's own copy, and no
+// reflinked copy whose destination still exists.
+func isUnreferenced(blobPath string, info fs.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || uint64(st.Nlink) > 1 {
+		return false
+	}
+	return !hasLiveReflink(blobPath)
+}
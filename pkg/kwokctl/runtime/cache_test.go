@@ -0,0 +1,178 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCommitBlobDedupesByDigest(t *testing.T) {
+	dir := t.TempDir()
+
+	tmp1 := filepath.Join(dir, "tmp-1")
+	if err := os.WriteFile(tmp1, []byte("first"), 0640); err != nil {
+		t.Fatalf("write tmp1: %v", err)
+	}
+	blob1, err := commitBlob(dir, tmp1, "digest")
+	if err != nil {
+		t.Fatalf("commitBlob: %v", err)
+	}
+
+	tmp2 := filepath.Join(dir, "tmp-2")
+	if err := os.WriteFile(tmp2, []byte("second"), 0640); err != nil {
+		t.Fatalf("write tmp2: %v", err)
+	}
+	blob2, err := commitBlob(dir, tmp2, "digest")
+	if err != nil {
+		t.Fatalf("commitBlob: %v", err)
+	}
+
+	if blob1 != blob2 {
+		t.Errorf("commitBlob with the same digest returned different paths: %q vs %q", blob1, blob2)
+	}
+
+	content, err := os.ReadFile(blob1)
+	if err != nil {
+		t.Fatalf("read blob: %v", err)
+	}
+	if string(content) != "first" {
+		t.Errorf("commitBlob overwrote an existing blob with a same-digest duplicate: got %q, want %q", content, "first")
+	}
+	if _, err := os.Stat(tmp2); err != nil {
+		t.Errorf("commitBlob should leave an unused tmpName for the caller to clean up, stat err = %v", err)
+	}
+}
+
+func TestMaterializeBlob(t *testing.T) {
+	dir := t.TempDir()
+	blobPath := filepath.Join(dir, "blob")
+	if err := os.WriteFile(blobPath, []byte("binary content"), 0640); err != nil {
+		t.Fatalf("write blob: %v", err)
+	}
+
+	dest := filepath.Join(dir, "materialized")
+	if err := materializeBlob(blobPath, dest, 0755); err != nil {
+		t.Fatalf("materializeBlob: %v", err)
+	}
+
+	content, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("read dest: %v", err)
+	}
+	if string(content) != "binary content" {
+		t.Errorf("materialized content = %q, want %q", content, "binary content")
+	}
+
+	info, err := os.Stat(dest)
+	if err != nil {
+		t.Fatalf("stat dest: %v", err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("materialized mode = %v, want 0755", info.Mode().Perm())
+	}
+}
+
+func TestMaterializeBlobSecondHardlinkDoesNotRechmodFirst(t *testing.T) {
+	dir := t.TempDir()
+	blobPath := filepath.Join(dir, "blob")
+	if err := os.WriteFile(blobPath, []byte("binary content"), 0640); err != nil {
+		t.Fatalf("write blob: %v", err)
+	}
+
+	destA := filepath.Join(dir, "cluster-a")
+	if err := materializeBlob(blobPath, destA, 0750); err != nil {
+		t.Fatalf("materializeBlob destA: %v", err)
+	}
+
+	destB := filepath.Join(dir, "cluster-b")
+	if err := materializeBlob(blobPath, destB, 0700); err != nil {
+		t.Fatalf("materializeBlob destB: %v", err)
+	}
+
+	infoA, err := os.Stat(destA)
+	if err != nil {
+		t.Fatalf("stat destA: %v", err)
+	}
+	if infoA.Mode().Perm() != 0750 {
+		t.Errorf("destA's mode changed to destB's when destB was hardlinked to the same blob: got %v, want 0750", infoA.Mode().Perm())
+	}
+}
+
+func TestIsUnreferenced(t *testing.T) {
+	dir := t.TempDir()
+	blobPath := filepath.Join(dir, "blob")
+	if err := os.WriteFile(blobPath, []byte("data"), 0640); err != nil {
+		t.Fatalf("write blob: %v", err)
+	}
+
+	info, err := os.Stat(blobPath)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if !isUnreferenced(blobPath, info) {
+		t.Errorf("a blob with no other hardlinks should be unreferenced")
+	}
+
+	linked := filepath.Join(dir, "materialized")
+	if err := os.Link(blobPath, linked); err != nil {
+		t.Skipf("hardlinks unsupported on this filesystem: %v", err)
+	}
+
+	info, err = os.Stat(blobPath)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if isUnreferenced(blobPath, info) {
+		t.Errorf("a blob with a materialized hardlink should not be unreferenced")
+	}
+}
+
+func TestIsUnreferencedWithLiveReflink(t *testing.T) {
+	dir := t.TempDir()
+	blobPath := filepath.Join(dir, "blob")
+	if err := os.WriteFile(blobPath, []byte("data"), 0640); err != nil {
+		t.Fatalf("write blob: %v", err)
+	}
+
+	// Simulate a reflinked materialization (reflink itself needs
+	// filesystem support this sandbox may lack): record the sidecar
+	// entry directly and create the destination it points at.
+	dest := filepath.Join(dir, "materialized")
+	if err := os.WriteFile(dest, []byte("data"), 0640); err != nil {
+		t.Fatalf("write dest: %v", err)
+	}
+	if err := recordReflink(blobPath, dest); err != nil {
+		t.Fatalf("recordReflink: %v", err)
+	}
+
+	info, err := os.Stat(blobPath)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if isUnreferenced(blobPath, info) {
+		t.Errorf("a blob with a live reflinked destination should not be unreferenced")
+	}
+
+	if err := os.Remove(dest); err != nil {
+		t.Fatalf("remove dest: %v", err)
+	}
+	if !isUnreferenced(blobPath, info) {
+		t.Errorf("a blob whose recorded reflink destination no longer exists should be unreferenced")
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/kwok/pkg/kwokctl/dryrun"
+	"sigs.k8s.io/kwok/pkg/kwokctl/pki"
+)
+
+// dryRunRunner records the operations a real Runner would have
+// performed into a dryrun.Recorder instead of performing them, so the
+// whole run can later be rendered as a shell script or Makefile.
+type dryRunRunner struct {
+	rec *dryrun.Recorder
+}
+
+func (r dryRunRunner) CreateFile(name string) error {
+	r.rec.Record(dryrun.OpWriteFile{Path: name})
+	return nil
+}
+
+func (r dryRunRunner) CopyFile(oldpath, newpath string) error {
+	r.rec.Record(dryrun.OpCopy{Src: oldpath, Dest: newpath})
+	return nil
+}
+
+func (r dryRunRunner) RenameFile(oldpath, newpath string) error {
+	r.rec.Record(dryrun.OpRename{Src: oldpath, Dest: newpath})
+	return nil
+}
+
+func (r dryRunRunner) AppendToFile(name string, content []byte) error {
+	r.rec.Record(dryrun.OpWriteFile{Path: name, Content: content})
+	return nil
+}
+
+func (r dryRunRunner) Remove(name string) error {
+	r.rec.Record(dryrun.OpRemove{Path: name})
+	return nil
+}
+
+func (r dryRunRunner) RemoveAll(name string) error {
+	r.rec.Record(dryrun.OpRemove{Path: name, Recursive: true})
+	return nil
+}
+
+func (r dryRunRunner) OpenFile(name string) (io.WriteCloser, error) {
+	return &recordingWriteCloser{rec: r.rec, path: name}, nil
+}
+
+func (r dryRunRunner) WriteFile(name string, content []byte) error {
+	r.rec.Record(dryrun.OpWriteFile{Path: name, Content: content})
+	return nil
+}
+
+func (r dryRunRunner) WriteFileWithMode(name string, content []byte, mode os.FileMode) error {
+	r.rec.Record(dryrun.OpWriteFile{Path: name, Content: content, Mode: mode})
+	return nil
+}
+
+func (r dryRunRunner) MkdirAll(name string) error {
+	r.rec.Record(dryrun.OpMkdir{Path: name})
+	return nil
+}
+
+func (r dryRunRunner) Download(ctx context.Context, cacheDir, src, dest string, mode fs.FileMode, quiet bool) error {
+	archiveSrc, extract := src, ""
+	if s := strings.SplitN(src, "#", 2); len(s) == 2 {
+		archiveSrc, extract = s[0], s[1]
+	}
+
+	kind := dryrun.DownloadHTTP
+	if isOCI(archiveSrc) {
+		kind = dryrun.DownloadOCI
+	}
+
+	r.rec.Record(dryrun.OpDownload{Src: archiveSrc, Dest: dest, Extract: extract, Kind: kind})
+	return nil
+}
+
+// GeneratePki records a PKI generation step. When materialize is true
+// (driven by ClusterOptions.DryRunMaterializePKI), it actually generates
+// the PKI into a scratch directory and tars it up so the rendered
+// artifact is self-contained; otherwise it only documents the step.
+func (r dryRunRunner) GeneratePki(pkiPath string, sans ...string) error {
+	if !r.materialize() {
+		r.rec.Record(dryrun.OpGeneratePKI{Path: pkiPath, SANs: sans})
+		return nil
+	}
+
+	scratch, err := os.MkdirTemp("", "kwokctl-dryrun-pki-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(scratch)
+	}()
+
+	if err := pki.GeneratePki(scratch, sans...); err != nil {
+		return err
+	}
+
+	content, err := tarDir(scratch)
+	if err != nil {
+		return err
+	}
+
+	r.rec.Record(dryrun.OpGeneratePKI{Path: pkiPath, SANs: sans, Content: content})
+	return nil
+}
+
+// OpenForRead is never called against a dryRunRunner: nothing it
+// records actually lands on disk for downloads that skip verification,
+// and a materialized dry-run download is verified against the Runner
+// that wrote it, not this one.
+func (r dryRunRunner) OpenForRead(name string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("open %s for read: a dry run that has not materialized this file has nothing to read", name)
+}
+
+// materialize reports whether GeneratePki should actually run and embed
+// its output rather than just document that it must run.
+func (r dryRunRunner) materialize() bool {
+	return r.rec != nil && r.rec.MaterializePKI
+}
+
+// tarDir archives dir's contents for embedding in a rendered artifact.
+func tarDir(dir string) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// recordingWriteCloser buffers writes from OpenFile and records them as
+// a single OpWriteFile on Close.
+type recordingWriteCloser struct {
+	rec  *dryrun.Recorder
+	path string
+	buf  bytes.Buffer
+}
+
+func (w *recordingWriteCloser) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *recordingWriteCloser) Close() error {
+	w.rec.Record(dryrun.OpWriteFile{Path: w.path, Content: w.buf.Bytes()})
+	return nil
+}
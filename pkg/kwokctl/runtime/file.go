@@ -21,138 +21,93 @@ import (
 	"io"
 	"io/fs"
 	"os"
-	"strings"
-
-	"sigs.k8s.io/kwok/pkg/kwokctl/dryrun"
-	"sigs.k8s.io/kwok/pkg/kwokctl/pki"
-	"sigs.k8s.io/kwok/pkg/utils/file"
 )
 
-// DownloadWithCache downloads the src file to the dest file.
-func (c *Cluster) DownloadWithCache(ctx context.Context, cacheDir, src, dest string, mode fs.FileMode, quiet bool) error {
-	if s := strings.SplitN(src, "#", 2); len(s) == 2 {
-		if c.IsDryRun() && !c.ShouldDownload() {
-			dryrun.PrintMessage("# Download %s and extract %s to %s", s[0], s[1], dest)
-			return nil
-		}
-		return file.DownloadWithCacheAndExtract(ctx, cacheDir, s[0], dest, s[1], mode, quiet, true, c.IsDryRun())
-	}
+// DownloadWithCache downloads the src file to the dest file, on whichever
+// backend c.hostRunner targets (the local filesystem, or a remote --host
+// over SFTP).
+//
+// src may also be an `oci://` reference (optionally suffixed with
+// `#path/inside/archive`), in which case the matching platform layer is
+// pulled from the registry instead of performing a plain HTTP(S) GET;
+// Runner.Download handles both the same way, via the shared blob store,
+// since registry credentials are resolved locally either way but the
+// materialized file still needs to land on the active backend.
+//
+// If opts configures a digest (and optionally a signature), dest is
+// verified after the download completes, read back through the same
+// Runner that wrote it; a mismatch deletes dest so the tampered file is
+// never reused from cache.
+func (c *Cluster) DownloadWithCache(ctx context.Context, cacheDir, src, dest string, mode fs.FileMode, quiet bool, opts ...DownloadOption) error {
+	dc := applyDownloadOptions(opts...)
 
 	if c.IsDryRun() && !c.ShouldDownload() {
-		dryrun.PrintMessage("# Download %s to %s", src, dest)
+		if err := c.Runner().Download(ctx, cacheDir, src, dest, mode, quiet); err != nil {
+			return err
+		}
+		printVerifyDryRun(c.dryRunRecorder, dest, dc)
 		return nil
 	}
-	return file.DownloadWithCache(ctx, cacheDir, src, dest, mode, quiet, c.IsDryRun())
+
+	if err := c.hostRunner.Download(ctx, cacheDir, src, dest, mode, quiet); err != nil {
+		return err
+	}
+	return verifyDownload(c.hostRunner, dest, dc)
 }
 
 // GeneratePki generates the pki for kwokctl
 func (c *Cluster) GeneratePki(pkiPath string, sans ...string) error {
-	if c.IsDryRun() {
-		dryrun.PrintMessage("# Generate PKI to %s", pkiPath)
-		return nil
-	}
-
-	return pki.GeneratePki(pkiPath, sans...)
+	return c.Runner().GeneratePki(pkiPath, sans...)
 }
 
 // CreateFile creates a file.
 func (c *Cluster) CreateFile(name string) error {
-	if c.IsDryRun() {
-		dryrun.PrintMessage("touch %s", name)
-		return nil
-	}
-
-	return file.Create(name)
+	return c.Runner().CreateFile(name)
 }
 
 // CopyFile copies a file from src to dst.
 func (c *Cluster) CopyFile(oldpath, newpath string) error {
-	if c.IsDryRun() {
-		dryrun.PrintMessage("cp %s %s", oldpath, newpath)
-		return nil
-	}
-
-	return file.Copy(oldpath, newpath)
+	return c.Runner().CopyFile(oldpath, newpath)
 }
 
 // RenameFile renames a file.
 func (c *Cluster) RenameFile(oldpath, newpath string) error {
-	if c.IsDryRun() {
-		dryrun.PrintMessage("mv %s %s", oldpath, newpath)
-		return nil
-	}
-
-	return file.Rename(oldpath, newpath)
+	return c.Runner().RenameFile(oldpath, newpath)
 }
 
 // AppendToFile appends content to a file.
 func (c *Cluster) AppendToFile(name string, content []byte) error {
-	if c.IsDryRun() {
-		dryrun.PrintMessage("cat <<EOF >>%s\n%s\nEOF", name, string(content))
-		return nil
-	}
-
-	return file.Append(name, content)
+	return c.Runner().AppendToFile(name, content)
 }
 
 // Remove removes a file.
 func (c *Cluster) Remove(name string) error {
-	if c.IsDryRun() {
-		dryrun.PrintMessage("rm %s", name)
-		return nil
-	}
-
-	return file.Remove(name)
+	return c.Runner().Remove(name)
 }
 
 // RemoveAll removes a directory and all its contents.
 func (c *Cluster) RemoveAll(name string) error {
-	if c.IsDryRun() {
-		dryrun.PrintMessage("rm -rf %s", name)
-		return nil
-	}
-
-	return file.RemoveAll(name)
+	return c.Runner().RemoveAll(name)
 }
 
 // OpenFile opens/creates a file for writing.
 func (c *Cluster) OpenFile(name string) (io.WriteCloser, error) {
-	if c.IsDryRun() {
-		return dryrun.NewCatToFileWriter(name), nil
-	}
-
-	return file.Open(name)
+	return c.Runner().OpenFile(name)
 }
 
 // WriteFile writes content to a file.
 func (c *Cluster) WriteFile(name string, content []byte) error {
-	if c.IsDryRun() {
-		dryrun.PrintMessage("cat <<EOF >%s\n%s\nEOF", name, string(content))
-		return nil
-	}
-
-	return file.Write(name, content)
+	return c.Runner().WriteFile(name, content)
 }
 
 // WriteFileWithMode writes content to a file with the given mode.
 func (c *Cluster) WriteFileWithMode(name string, content []byte, mode os.FileMode) error {
-	if c.IsDryRun() {
-		dryrun.PrintMessage("cat <<EOF >%s\n%s\nEOF", name, string(content))
-		dryrun.PrintMessage("chmod 0%o %s", mode, name)
-		return nil
-	}
-
-	return file.WriteWithMode(name, content, mode)
+	return c.Runner().WriteFileWithMode(name, content, mode)
 }
 
 // MkdirAll creates a directory.
 func (c *Cluster) MkdirAll(name string) error {
-	if c.IsDryRun() {
-		dryrun.PrintMessage("mkdir -p %s", name)
-		return nil
-	}
-
-	return file.MkdirAll(name)
+	return c.Runner().MkdirAll(name)
 }
 
 // EnsureBinary ensures the binary exists.
@@ -164,7 +119,7 @@ func (c *Cluster) EnsureBinary(ctx context.Context, name, binary string) (string
 	conf := config.Options
 
 	binaryPath := c.GetBinPath(name + conf.BinSuffix)
-	err = c.DownloadWithCache(ctx, conf.CacheDir, binary, binaryPath, 0750, conf.QuietPull)
+	err = c.DownloadWithCache(ctx, conf.CacheDir, binary, binaryPath, 0750, conf.QuietPull, componentDownloadOptions(conf.ComponentVerify, name, binary)...)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,91 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+
+	"sigs.k8s.io/kwok/pkg/kwokctl/pki"
+	"sigs.k8s.io/kwok/pkg/utils/file"
+)
+
+// localRunner runs operations against the local filesystem, the
+// behavior every Cluster had before Runner existed.
+type localRunner struct{}
+
+func (localRunner) CreateFile(name string) error {
+	return file.Create(name)
+}
+
+func (localRunner) CopyFile(oldpath, newpath string) error {
+	return file.Copy(oldpath, newpath)
+}
+
+func (localRunner) RenameFile(oldpath, newpath string) error {
+	return file.Rename(oldpath, newpath)
+}
+
+func (localRunner) AppendToFile(name string, content []byte) error {
+	return file.Append(name, content)
+}
+
+func (localRunner) Remove(name string) error {
+	return file.Remove(name)
+}
+
+func (localRunner) RemoveAll(name string) error {
+	return file.RemoveAll(name)
+}
+
+func (localRunner) OpenFile(name string) (io.WriteCloser, error) {
+	return file.Open(name)
+}
+
+func (localRunner) WriteFile(name string, content []byte) error {
+	return file.Write(name, content)
+}
+
+func (localRunner) WriteFileWithMode(name string, content []byte, mode os.FileMode) error {
+	return file.WriteWithMode(name, content, mode)
+}
+
+func (localRunner) MkdirAll(name string) error {
+	return file.MkdirAll(name)
+}
+
+// Download fetches src into the cacheDir content-addressable blob store
+// (see fetchToBlobStore) and materializes it at dest, sharing one
+// on-disk copy of the blob across every cluster that downloads the same
+// src.
+func (localRunner) Download(ctx context.Context, cacheDir, src, dest string, mode fs.FileMode, quiet bool) error {
+	blobPath, err := fetchToBlobStore(ctx, cacheDir, src, quiet)
+	if err != nil {
+		return err
+	}
+	return materializeBlob(blobPath, dest, mode)
+}
+
+func (localRunner) GeneratePki(pkiPath string, sans ...string) error {
+	return pki.GeneratePki(pkiPath, sans...)
+}
+
+func (localRunner) OpenForRead(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
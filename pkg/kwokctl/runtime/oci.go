@@ -0,0 +1,162 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	goruntime "runtime"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// defaultBinaryLayerMediaType is the media type kwok looks for when an
+// OCI artifact bundles more than one file and does not otherwise say
+// which layer carries the binary for the running platform.
+const defaultBinaryLayerMediaType = "application/vnd.kwok.binary.layer.v1+tar"
+
+// ociRef is a parsed `oci://` source, optionally carrying a `#path/inside/archive`
+// suffix using the same convention as plain HTTP(S) sources.
+type ociRef struct {
+	reference string
+	path      string
+}
+
+// isOCI reports whether src names an OCI artifact rather than an HTTP(S) URL.
+func isOCI(src string) bool {
+	return strings.HasPrefix(src, "oci://")
+}
+
+// parseOCIRef splits src#path into the bare reference and the optional
+// in-archive path, stripping the oci:// scheme expected by go-containerregistry.
+func parseOCIRef(src string) ociRef {
+	ref := strings.TrimPrefix(src, "oci://")
+	if s := strings.SplitN(ref, "#", 2); len(s) == 2 {
+		return ociRef{reference: s[0], path: s[1]}
+	}
+	return ociRef{reference: ref}
+}
+
+// fetchOCIToBlobStore resolves ref, selects the layer matching the
+// current platform (falling back to defaultBinaryLayerMediaType for
+// artifacts that are not platform-specific image indexes), and stores it
+// in the content-addressable blob store under cacheDir — the same store
+// fetchURLToBlobStore uses for plain HTTP(S) sources, so a cluster
+// pulling the same component as an OCI artifact or over HTTP still only
+// keeps one on-disk copy. If ref.path is set, the single file extracted
+// from the layer is stored as its own blob, honoring the `src#path`
+// convention plain archive sources use.
+//
+// Registry auth always runs locally (it reads the docker config on the
+// machine running kwokctl), but the resulting blob is materialized onto
+// whichever backend Runner.Download is targeting — local or, for a
+// --host cluster, the remote machine over SFTP.
+func fetchOCIToBlobStore(ctx context.Context, cacheDir string, ref ociRef, quiet bool) (string, error) {
+	opts, err := ociOptions(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	tag, err := name.ParseReference(ref.reference, name.WithDefaultRegistry(""))
+	if err != nil {
+		return "", fmt.Errorf("parse oci reference %q: %w", ref.reference, err)
+	}
+
+	img, err := ociSelectImage(tag, opts...)
+	if err != nil {
+		return "", fmt.Errorf("resolve oci reference %q: %w", ref.reference, err)
+	}
+
+	layer, err := ociSelectLayer(img)
+	if err != nil {
+		return "", fmt.Errorf("select layer for %q: %w", ref.reference, err)
+	}
+
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return "", fmt.Errorf("open layer for %q: %w", ref.reference, err)
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+
+	dir := blobsDir(cacheDir, "sha256")
+	layerBlob, err := writeToBlobStore(dir, rc)
+	if err != nil {
+		return "", err
+	}
+	if ref.path == "" {
+		return layerBlob, nil
+	}
+	return extractEntryToBlobStore(dir, layerBlob, ref.path, quiet)
+}
+
+// ociOptions builds the remote options used to talk to the registry,
+// authenticating with the standard docker config (~/.docker/config.json,
+// overridable via DOCKER_CONFIG) the same way `docker`/`crane` do. ctx is
+// threaded through so a command timeout or Ctrl-C cancels an in-flight
+// registry pull instead of running to completion regardless.
+func ociOptions(ctx context.Context) ([]crane.Option, error) {
+	return []crane.Option{
+		crane.WithContext(ctx),
+		crane.WithAuthFromKeychain(authn.DefaultKeychain),
+	}, nil
+}
+
+// ociSelectImage resolves tag to a single-platform image, descending into
+// an image index for the current GOOS/GOARCH when the reference points
+// at a multi-arch artifact.
+func ociSelectImage(ref name.Reference, opts ...crane.Option) (v1.Image, error) {
+	desc, err := crane.Head(ref.String(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	if desc.MediaType.IsIndex() {
+		return crane.Pull(ref.String(), append(opts, crane.WithPlatform(&v1.Platform{
+			OS:           goruntime.GOOS,
+			Architecture: goruntime.GOARCH,
+		}))...)
+	}
+	return crane.Pull(ref.String(), opts...)
+}
+
+// ociSelectLayer picks the layer carrying the kwok binary: the sole
+// layer if there is only one, otherwise the first layer whose media type
+// is defaultBinaryLayerMediaType.
+func ociSelectLayer(img v1.Image) (v1.Layer, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	if len(layers) == 1 {
+		return layers[0], nil
+	}
+	for _, l := range layers {
+		mt, err := l.MediaType()
+		if err != nil {
+			return nil, err
+		}
+		if string(mt) == defaultBinaryLayerMediaType {
+			return l, nil
+		}
+	}
+	return nil, fmt.Errorf("no layer matches media type %q among %d layers", defaultBinaryLayerMediaType, len(layers))
+}
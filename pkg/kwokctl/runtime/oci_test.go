@@ -0,0 +1,58 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import "testing"
+
+func TestIsOCI(t *testing.T) {
+	cases := map[string]bool{
+		"oci://ghcr.io/kwok/kwok:v0.5.0": true,
+		"https://example.com/kwok":       false,
+		"kwok":                           false,
+	}
+	for src, want := range cases {
+		if got := isOCI(src); got != want {
+			t.Errorf("isOCI(%q) = %v, want %v", src, got, want)
+		}
+	}
+}
+
+func TestParseOCIRef(t *testing.T) {
+	tests := []struct {
+		src  string
+		want ociRef
+	}{
+		{
+			src:  "oci://ghcr.io/kwok/kwok:v0.5.0",
+			want: ociRef{reference: "ghcr.io/kwok/kwok:v0.5.0"},
+		},
+		{
+			src:  "oci://ghcr.io/kwok/kwok@sha256:abcd",
+			want: ociRef{reference: "ghcr.io/kwok/kwok@sha256:abcd"},
+		},
+		{
+			src:  "oci://ghcr.io/kwok/kwok:v0.5.0#bin/kwok",
+			want: ociRef{reference: "ghcr.io/kwok/kwok:v0.5.0", path: "bin/kwok"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := parseOCIRef(tt.src); got != tt.want {
+			t.Errorf("parseOCIRef(%q) = %+v, want %+v", tt.src, got, tt.want)
+		}
+	}
+}
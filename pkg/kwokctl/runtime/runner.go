@@ -0,0 +1,92 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// Runner performs the filesystem and download operations backing
+// Cluster's file methods. It is the seam between "what kwokctl wants to
+// do to a cluster's workdir" and "where that workdir actually lives" —
+// on this machine, or on a remote host reached over SSH.
+type Runner interface {
+	CreateFile(name string) error
+	CopyFile(oldpath, newpath string) error
+	RenameFile(oldpath, newpath string) error
+	AppendToFile(name string, content []byte) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	OpenFile(name string) (io.WriteCloser, error)
+	WriteFile(name string, content []byte) error
+	WriteFileWithMode(name string, content []byte, mode os.FileMode) error
+	MkdirAll(name string) error
+	Download(ctx context.Context, cacheDir, src, dest string, mode fs.FileMode, quiet bool) error
+	GeneratePki(pkiPath string, sans ...string) error
+	// OpenForRead opens name for reading on whichever backend actually
+	// wrote it, so callers (verifyDigest in particular) hash the bytes
+	// that were really written rather than assuming a local path.
+	OpenForRead(name string) (io.ReadCloser, error)
+}
+
+// HostOptions configures the --host flag: a remote machine a cluster's
+// workdir lives on, reached over SSH instead of the local filesystem.
+type HostOptions struct {
+	// Address is "[user@]host[:port]". Empty means local.
+	Address string
+	// IdentityFile is the path to the SSH private key to authenticate with.
+	IdentityFile string
+	// JumpHost is an optional "[user@]host[:port]" to tunnel the
+	// connection to Address through.
+	JumpHost string
+	// KnownHostsFile, when set, verifies the remote host's key against a
+	// standard OpenSSH known_hosts file instead of trusting whatever key
+	// is presented.
+	KnownHostsFile string
+}
+
+// Runner returns the backend that Cluster's file methods (other than
+// DownloadWithCache, which has its own dry-run/cache handling) dispatch
+// through: a dryRunRunner while c.IsDryRun(), otherwise the
+// local-or-SSH backend resolved for this cluster from
+// ClusterOptions.Host when it was created.
+func (c *Cluster) Runner() Runner {
+	if c.IsDryRun() {
+		return dryRunRunner{rec: c.dryRunRecorder}
+	}
+	return c.hostRunner
+}
+
+// newHostRunner resolves the Runner backing non-dry-run operations,
+// based on the --host/ClusterOptions.Host setting: empty means the
+// cluster's workdir is local, anything else names a host to run
+// commands and move files through over SSH.
+//
+// Cluster's constructor is expected to call this once per cluster, with
+// ClusterOptions.Host, and store the result as hostRunner; dryRunRecorder
+// is set the same way from NewRecorder when ClusterOptions.DryRun is set.
+// Those fields and the --host flag itself live alongside the rest of
+// Cluster's state, not in this file.
+func newHostRunner(host HostOptions) (Runner, error) {
+	if host.Address == "" {
+		return localRunner{}, nil
+	}
+	return newSSHRunner(host)
+}
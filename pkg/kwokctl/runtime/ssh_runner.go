@@ -0,0 +1,290 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"sigs.k8s.io/kwok/pkg/kwokctl/pki"
+)
+
+// sshRunner performs Cluster's file operations on a remote host over
+// SSH, so `kwokctl create cluster --host user@box` can stand a cluster
+// up on a machine other than the one running kwokctl.
+type sshRunner struct {
+	client *ssh.Client
+	sftp   *sftp.Client
+}
+
+// newSSHRunner dials host (optionally through host.JumpHost) and opens
+// an SFTP session over the same connection for file transfer.
+func newSSHRunner(host HostOptions) (*sshRunner, error) {
+	client, err := dialSSH(host.Address, host.IdentityFile, host.JumpHost, host.KnownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", host.Address, err)
+	}
+
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("open sftp session to %s: %w", host.Address, err)
+	}
+
+	return &sshRunner{client: client, sftp: sftpClient}, nil
+}
+
+// dialSSH connects to addr ("[user@]host[:port]"), authenticating with
+// the private key at identityFile, tunneling through jump if it is set,
+// and verifying the remote host key against knownHostsFile when one is
+// configured.
+func dialSSH(addr, identityFile, jump, knownHostsFile string) (*ssh.Client, error) {
+	user, hostport := splitUserHost(addr)
+
+	key, err := os.ReadFile(identityFile)
+	if err != nil {
+		return nil, fmt.Errorf("read identity file %s: %w", identityFile, err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("parse identity file %s: %w", identityFile, err)
+	}
+
+	hostKeyCallback, err := sshHostKeyCallback(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("load known hosts file %s: %w", knownHostsFile, err)
+	}
+
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+	}
+
+	if jump == "" {
+		return ssh.Dial("tcp", hostport, config)
+	}
+
+	jumpClient, err := dialSSH(jump, identityFile, "", knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("dial jump host %s: %w", jump, err)
+	}
+	conn, err := jumpClient.Dial("tcp", hostport)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s through jump host %s: %w", hostport, jump, err)
+	}
+	ncc, chans, reqs, err := ssh.NewClientConn(conn, hostport, config)
+	if err != nil {
+		return nil, fmt.Errorf("handshake with %s through jump host %s: %w", hostport, jump, err)
+	}
+	return ssh.NewClient(ncc, chans, reqs), nil
+}
+
+// sshHostKeyCallback returns a callback that verifies the remote host's
+// key against knownHostsFile (the standard OpenSSH known_hosts format).
+// With no file configured, it falls back to accepting any key, same as
+// before --host-known-hosts existed, at the caller's risk.
+func sshHostKeyCallback(knownHostsFile string) (ssh.HostKeyCallback, error) {
+	if knownHostsFile == "" {
+		return ssh.InsecureIgnoreHostKey(), nil //nolint:gosec // no known_hosts file configured for this --host.
+	}
+	return knownhosts.New(knownHostsFile)
+}
+
+// splitUserHost splits "[user@]host[:port]", defaulting port to :22 and
+// user to the current OS user if either is omitted.
+func splitUserHost(addr string) (user, hostport string) {
+	user = os.Getenv("USER")
+	if u, h, ok := strings.Cut(addr, "@"); ok {
+		user, addr = u, h
+	}
+	if !strings.Contains(addr, ":") {
+		addr += ":22"
+	}
+	return user, addr
+}
+
+func (r *sshRunner) CreateFile(name string) error {
+	f, err := r.sftp.Create(name)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (r *sshRunner) CopyFile(oldpath, newpath string) error {
+	src, err := r.sftp.Open(oldpath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	dst, err := r.sftp.Create(newpath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = dst.Close()
+	}()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+func (r *sshRunner) RenameFile(oldpath, newpath string) error {
+	return r.sftp.Rename(oldpath, newpath)
+}
+
+func (r *sshRunner) AppendToFile(name string, content []byte) error {
+	f, err := r.sftp.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	_, err = f.Write(content)
+	return err
+}
+
+func (r *sshRunner) Remove(name string) error {
+	return r.sftp.Remove(name)
+}
+
+func (r *sshRunner) RemoveAll(name string) error {
+	return r.sftp.RemoveAll(name)
+}
+
+func (r *sshRunner) OpenFile(name string) (io.WriteCloser, error) {
+	return r.sftp.Create(name)
+}
+
+func (r *sshRunner) WriteFile(name string, content []byte) error {
+	f, err := r.sftp.Create(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	_, err = f.Write(content)
+	return err
+}
+
+func (r *sshRunner) WriteFileWithMode(name string, content []byte, mode os.FileMode) error {
+	if err := r.WriteFile(name, content); err != nil {
+		return err
+	}
+	return r.sftp.Chmod(name, mode)
+}
+
+func (r *sshRunner) MkdirAll(name string) error {
+	return r.sftp.MkdirAll(name)
+}
+
+// Download fetches src into the local cacheDir (registry/HTTP auth is
+// only configured on the machine running kwokctl), then copies the
+// cached file to dest on the remote host over SFTP.
+func (r *sshRunner) Download(ctx context.Context, cacheDir, src, dest string, mode fs.FileMode, quiet bool) error {
+	blobPath, err := fetchToBlobStore(ctx, cacheDir, src, quiet)
+	if err != nil {
+		return err
+	}
+
+	local, err := os.Open(blobPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = local.Close()
+	}()
+
+	remote, err := r.sftp.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = remote.Close()
+	}()
+
+	if _, err := io.Copy(remote, local); err != nil {
+		return err
+	}
+	return r.sftp.Chmod(dest, mode)
+}
+
+// GeneratePki generates the PKI into a local scratch directory (the pki
+// package only knows how to write to a local path) and pushes the
+// resulting files to pkiPath on the remote host over SFTP.
+func (r *sshRunner) GeneratePki(pkiPath string, sans ...string) error {
+	scratch, err := os.MkdirTemp("", "kwokctl-ssh-pki-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(scratch)
+	}()
+
+	if err := pki.GeneratePki(scratch, sans...); err != nil {
+		return err
+	}
+
+	return filepath.Walk(scratch, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(scratch, p)
+		if err != nil {
+			return err
+		}
+		remote := path.Join(pkiPath, filepath.ToSlash(rel))
+
+		if info.IsDir() {
+			return r.sftp.MkdirAll(remote)
+		}
+
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return r.WriteFileWithMode(remote, content, info.Mode())
+	})
+}
+
+func (r *sshRunner) OpenForRead(name string) (io.ReadCloser, error) {
+	return r.sftp.Open(name)
+}
+
+// Close releases the underlying SFTP and SSH connections.
+func (r *sshRunner) Close() error {
+	_ = r.sftp.Close()
+	return r.client.Close()
+}
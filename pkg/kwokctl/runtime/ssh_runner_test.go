@@ -0,0 +1,55 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitUserHost(t *testing.T) {
+	tests := []struct {
+		addr         string
+		wantUser     string
+		wantHostPort string
+	}{
+		{addr: "box.example.com", wantHostPort: "box.example.com:22"},
+		{addr: "box.example.com:2222", wantHostPort: "box.example.com:2222"},
+		{addr: "kwok@box.example.com", wantUser: "kwok", wantHostPort: "box.example.com:22"},
+		{addr: "kwok@box.example.com:2222", wantUser: "kwok", wantHostPort: "box.example.com:2222"},
+	}
+
+	for _, tt := range tests {
+		user, hostport := splitUserHost(tt.addr)
+		if tt.wantUser != "" && user != tt.wantUser {
+			t.Errorf("splitUserHost(%q) user = %q, want %q", tt.addr, user, tt.wantUser)
+		}
+		if hostport != tt.wantHostPort {
+			t.Errorf("splitUserHost(%q) hostport = %q, want %q", tt.addr, hostport, tt.wantHostPort)
+		}
+	}
+}
+
+func TestSSHHostKeyCallback(t *testing.T) {
+	if _, err := sshHostKeyCallback(""); err != nil {
+		t.Errorf("sshHostKeyCallback(\"\") should fall back to accepting any key, got error: %v", err)
+	}
+
+	if _, err := sshHostKeyCallback(filepath.Join(t.TempDir(), "missing-known-hosts")); err == nil {
+		t.Errorf("sshHostKeyCallback with a nonexistent known_hosts file should error")
+	}
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	"sigs.k8s.io/kwok/pkg/kwokctl/dryrun"
+)
+
+// Digest is a `<algorithm>:<hex>` expected checksum for a downloaded file,
+// e.g. `sha256:2c26b46b...`.
+type Digest struct {
+	Algorithm string
+	Hex       string
+}
+
+// String renders the digest back into `<algorithm>:<hex>` form.
+func (d Digest) String() string {
+	return d.Algorithm + ":" + d.Hex
+}
+
+// IsZero reports whether no digest was configured.
+func (d Digest) IsZero() bool {
+	return d.Hex == ""
+}
+
+// ParseDigest parses a `sha256:...` or `sha512:...` string.
+func ParseDigest(s string) (Digest, error) {
+	algo, hex, ok := strings.Cut(s, ":")
+	if !ok {
+		return Digest{}, fmt.Errorf("invalid digest %q: expected <algorithm>:<hex>", s)
+	}
+	switch algo {
+	case "sha256", "sha512":
+	default:
+		return Digest{}, fmt.Errorf("invalid digest %q: unsupported algorithm %q", s, algo)
+	}
+	return Digest{Algorithm: algo, Hex: hex}, nil
+}
+
+// newHash returns the hash.Hash implementation for the digest's algorithm.
+func (d Digest) newHash() (hash.Hash, error) {
+	switch d.Algorithm {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported digest algorithm %q", d.Algorithm)
+	}
+}
+
+// Signature is a cosign-style detached signature verified with a raw
+// public key: the signature bytes are fetched from SigURL (base64,
+// matching `cosign sign-blob`'s default output) and checked against the
+// expected Digest using PublicKeyPEM.
+type Signature struct {
+	PublicKeyPEM []byte
+	SigURL       string
+}
+
+// IsZero reports whether no signature was configured.
+func (s Signature) IsZero() bool {
+	return s.SigURL == ""
+}
+
+// DownloadOption configures digest and signature verification for
+// DownloadWithCache and EnsureBinary.
+type DownloadOption func(*downloadConfig)
+
+// downloadConfig holds the verification settings collected from DownloadOptions.
+type downloadConfig struct {
+	digest    Digest
+	signature Signature
+}
+
+// WithDigest requires the downloaded file to match d, deleting the cache
+// entry and failing the download on mismatch.
+func WithDigest(d Digest) DownloadOption {
+	return func(c *downloadConfig) {
+		c.digest = d
+	}
+}
+
+// WithSignature additionally requires the downloaded file's digest to be
+// signed by s. WithDigest must also be set, since the signature is
+// verified over the digest rather than the raw file.
+func WithSignature(s Signature) DownloadOption {
+	return func(c *downloadConfig) {
+		c.signature = s
+	}
+}
+
+// ComponentVerify is the per-component (or per-URL) verification policy
+// configured on the cluster config's Options.ComponentVerify field (the
+// same config surface as Options.BinSuffix/CacheDir/QuietPull, read via
+// c.Config(ctx).Options in EnsureBinary), keyed by component name (e.g.
+// "kube-apiserver") or, failing that, by the literal binary URL.
+type ComponentVerify struct {
+	Digest    Digest
+	Signature Signature
+}
+
+// componentDownloadOptions builds the DownloadOptions for EnsureBinary's
+// call to DownloadWithCache, looking the component up by name first and
+// then by its resolved URL.
+func componentDownloadOptions(verify map[string]ComponentVerify, name, binary string) []DownloadOption {
+	cv, ok := verify[name]
+	if !ok {
+		cv, ok = verify[binary]
+	}
+	if !ok || cv.Digest.IsZero() {
+		return nil
+	}
+
+	opts := []DownloadOption{WithDigest(cv.Digest)}
+	if !cv.Signature.IsZero() {
+		opts = append(opts, WithSignature(cv.Signature))
+	}
+	return opts
+}
+
+// applyDownloadOptions collects opts into a downloadConfig.
+func applyDownloadOptions(opts ...DownloadOption) downloadConfig {
+	var c downloadConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// printVerifyDryRun records the verification that verifyDownload would
+// otherwise have performed against dest.
+func printVerifyDryRun(rec *dryrun.Recorder, dest string, dc downloadConfig) {
+	if dc.digest.IsZero() {
+		return
+	}
+	rec.Record(dryrun.OpVerify{
+		Path:      dest,
+		Digest:    dc.digest.String(),
+		SigURL:    dc.signature.SigURL,
+		PublicKey: dc.signature.PublicKeyPEM,
+	})
+}
+
+// verifyDownload checks dest against dc using r, the same Runner that
+// wrote dest, removing dest on any failure so a tampered or truncated
+// download is never reused from cache.
+func verifyDownload(r Runner, dest string, dc downloadConfig) error {
+	if dc.digest.IsZero() {
+		return nil
+	}
+
+	if err := verifyDigest(r, dest, dc.digest); err != nil {
+		_ = r.Remove(dest)
+		return err
+	}
+
+	if !dc.signature.IsZero() {
+		if err := verifySignature(dc.digest, dc.signature); err != nil {
+			_ = r.Remove(dest)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verifyDigest streams dest, read back through r (the Runner that wrote
+// it — local or over SFTP for a --host cluster), through the digest's
+// hash algorithm and compares the result against the expected hex value.
+func verifyDigest(r Runner, dest string, d Digest) error {
+	h, err := d.newHash()
+	if err != nil {
+		return err
+	}
+
+	f, err := r.OpenForRead(dest)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+
+	if got := fmt.Sprintf("%x", h.Sum(nil)); got != d.Hex {
+		return fmt.Errorf("digest mismatch for %s: want %s, got %s:%s", dest, d, d.Algorithm, got)
+	}
+	return nil
+}
+
+// verifySignature fetches the detached, base64-encoded signature from
+// sig.SigURL and verifies it against d using sig.PublicKeyPEM.
+func verifySignature(d Digest, sig Signature) error {
+	block, _ := pem.Decode(sig.PublicKeyPEM)
+	if block == nil {
+		return fmt.Errorf("invalid public key: no PEM block found")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("parse public key: %w", err)
+	}
+	ecdsaPub, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("unsupported public key type %T, want ECDSA", pub)
+	}
+
+	resp, err := http.Get(sig.SigURL) //nolint:gosec // sig.SigURL is operator-configured, not user input.
+	if err != nil {
+		return fmt.Errorf("fetch signature %s: %w", sig.SigURL, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch signature %s: unexpected status %s", sig.SigURL, resp.Status)
+	}
+
+	encoded, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read signature %s: %w", sig.SigURL, err)
+	}
+	sigBytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("decode signature %s: %w", sig.SigURL, err)
+	}
+
+	digestBytes, err := hex.DecodeString(d.Hex)
+	if err != nil {
+		return fmt.Errorf("decode digest %s: %w", d, err)
+	}
+	if !ecdsa.VerifyASN1(ecdsaPub, digestBytes, sigBytes) {
+		return fmt.Errorf("signature %s does not verify against digest %s", sig.SigURL, d)
+	}
+	return nil
+}
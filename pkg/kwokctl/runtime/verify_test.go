@@ -0,0 +1,112 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDigest(t *testing.T) {
+	d, err := ParseDigest("sha256:2c26b46b")
+	if err != nil {
+		t.Fatalf("ParseDigest: %v", err)
+	}
+	if d.Algorithm != "sha256" || d.Hex != "2c26b46b" {
+		t.Errorf("ParseDigest = %+v, want {sha256 2c26b46b}", d)
+	}
+	if got := d.String(); got != "sha256:2c26b46b" {
+		t.Errorf("String() = %q, want %q", got, "sha256:2c26b46b")
+	}
+	if d.IsZero() {
+		t.Errorf("IsZero() = true for a parsed digest")
+	}
+
+	if _, err := ParseDigest("not-a-digest"); err == nil {
+		t.Errorf("ParseDigest(%q) expected an error", "not-a-digest")
+	}
+	if _, err := ParseDigest("md5:abcd"); err == nil {
+		t.Errorf("ParseDigest with unsupported algorithm expected an error")
+	}
+
+	var zero Digest
+	if !zero.IsZero() {
+		t.Errorf("IsZero() = false for the zero value")
+	}
+}
+
+func TestComponentDownloadOptions(t *testing.T) {
+	digest, err := ParseDigest("sha256:deadbeef")
+	if err != nil {
+		t.Fatalf("ParseDigest: %v", err)
+	}
+	verify := map[string]ComponentVerify{
+		"kube-apiserver":           {Digest: digest},
+		"https://example.com/etcd": {Digest: digest},
+	}
+
+	if opts := componentDownloadOptions(verify, "kube-apiserver", "https://example.com/kube-apiserver"); len(opts) != 1 {
+		t.Errorf("expected a digest option for a component matched by name, got %d", len(opts))
+	}
+	if opts := componentDownloadOptions(verify, "etcd", "https://example.com/etcd"); len(opts) != 1 {
+		t.Errorf("expected a digest option for a component matched by URL, got %d", len(opts))
+	}
+	if opts := componentDownloadOptions(verify, "kwok", "https://example.com/kwok"); opts != nil {
+		t.Errorf("expected no options for an unconfigured component, got %v", opts)
+	}
+}
+
+func TestVerifyDownload(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "binary")
+	if err := os.WriteFile(dest, []byte("hello world"), 0600); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+
+	// sha256("hello world")
+	const wantHex = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+
+	r := localRunner{}
+
+	if err := verifyDownload(r, dest, downloadConfig{}); err != nil {
+		t.Errorf("verifyDownload with no digest configured: %v", err)
+	}
+
+	match, err := ParseDigest("sha256:" + wantHex)
+	if err != nil {
+		t.Fatalf("ParseDigest: %v", err)
+	}
+	if err := verifyDownload(r, dest, downloadConfig{digest: match}); err != nil {
+		t.Errorf("verifyDownload with a matching digest: %v", err)
+	}
+	if _, err := os.Stat(dest); err != nil {
+		t.Errorf("dest should survive a successful verification: %v", err)
+	}
+
+	mismatch, err := ParseDigest("sha256:" + strings.Repeat("0", 64))
+	if err != nil {
+		t.Fatalf("ParseDigest: %v", err)
+	}
+	if err := verifyDownload(r, dest, downloadConfig{digest: mismatch}); err == nil {
+		t.Errorf("verifyDownload with a mismatched digest should fail")
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("dest should be removed after a digest mismatch, stat err = %v", err)
+	}
+}